@@ -0,0 +1,88 @@
+package iostep_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"gopkg.in/niemeyer/iostep.v0"
+)
+
+// slowReader simulates a wrapped reader that takes a while to produce
+// output on its own, independent of anything fed to it via Step, such
+// as a decoder chewing through a large block before asking for more
+// input. Its Read call is never forced to return early: it only does
+// so once the delay has passed, at which point Close is called, so
+// that a test can confirm that happened on the read loop goroutine
+// rather than concurrently with the still-running Read call.
+type slowReader struct {
+	delay  time.Duration
+	closed chan struct{}
+}
+
+func (r *slowReader) Read(data []byte) (int, error) {
+	<-time.After(r.delay)
+	return 0, io.EOF
+}
+
+func (r *slowReader) Close() error {
+	close(r.closed)
+	return nil
+}
+
+func TestReaderStepContextTimeout(t *testing.T) {
+	sr := &slowReader{delay: 50 * time.Millisecond, closed: make(chan struct{})}
+	s := iostep.NewReader(func(r io.Reader) (io.Reader, error) {
+		return sr, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := s.StepContext(ctx, []byte("x"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > sr.delay {
+		t.Fatalf("StepContext waited on the wrapped reader instead of ctx: took %v", elapsed)
+	}
+
+	_, err = s.Step(nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want context.DeadlineExceeded on subsequent Step, got %v", err)
+	}
+
+	// The wrapped reader is only closed once its Read call returns on
+	// its own, from the read loop goroutine, never concurrently with
+	// that call.
+	select {
+	case <-sr.closed:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("wrapped reader was never closed after its Read call returned")
+	}
+}
+
+func TestReaderWithMaxPendingBytes(t *testing.T) {
+	s := iostep.NewReader(func(r io.Reader) (io.Reader, error) {
+		return r, nil
+	}, iostep.WithMaxPendingBytes(4))
+
+	_, err := s.Step([]byte("too much data"))
+	if err == nil {
+		t.Fatalf("want an error, got nil")
+	}
+}
+
+func TestReaderWithUnboundedPending(t *testing.T) {
+	s := iostep.NewReader(func(r io.Reader) (io.Reader, error) {
+		return r, nil
+	}, iostep.WithMaxPendingBytes(4), iostep.WithUnboundedPending())
+
+	got, err := s.Step([]byte("more than four bytes"))
+	if err != nil || string(got) != "more than four bytes" {
+		t.Fatalf("want %q, got %q with err %v", "more than four bytes", got, err)
+	}
+}
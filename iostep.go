@@ -1,11 +1,16 @@
 package iostep
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"sync"
 )
 
+const (
+	defaultReadBufferSize  = 8192
+	defaultMaxPendingBytes = 1024 * 1024
+)
 
 // A StepReader transforms a reader type that processes data in
 // a blocking way into a simpler non-blocking interface that
@@ -16,6 +21,12 @@ type StepReader struct {
 
 	newr func(r io.Reader) (io.Reader, error)
 
+	ctx context.Context
+
+	readBufSize      int
+	maxPending       int
+	unboundedPending bool
+
 	input []byte
 	insig *sync.Cond
 
@@ -25,6 +36,49 @@ type StepReader struct {
 	result []byte
 
 	reading bool
+
+	wrapped     io.Reader
+	wrappedDone bool
+}
+
+// An Option configures a StepReader created by NewReader.
+type Option func(*StepReader)
+
+// WithReadBufferSize sets the size of the buffer used to read from
+// the wrapped reader on every pass of the read loop. It defaults to
+// 8 KiB.
+func WithReadBufferSize(size int) Option {
+	return func(s *StepReader) {
+		s.readBufSize = size
+	}
+}
+
+// WithMaxPendingBytes sets how many bytes of output the wrapped
+// reader may produce ahead of a single Step call before the stepper
+// gives up with an error. It defaults to 1 MiB.
+func WithMaxPendingBytes(n int) Option {
+	return func(s *StepReader) {
+		s.maxPending = n
+		s.unboundedPending = false
+	}
+}
+
+// WithUnboundedPending disables the pending output cap entirely, for
+// wrapped readers that are known to read far ahead of their callers
+// such as read-ahead buffers.
+func WithUnboundedPending() Option {
+	return func(s *StepReader) {
+		s.unboundedPending = true
+	}
+}
+
+// WithContext sets the context used by Step and Close when no
+// explicit context is provided via StepContext or CloseContext. It
+// defaults to context.Background().
+func WithContext(ctx context.Context) Option {
+	return func(s *StepReader) {
+		s.ctx = ctx
+	}
 }
 
 // Reader returns a new stepper that uses the reader returned by
@@ -36,7 +90,22 @@ type StepReader struct {
 // method will be called when EOF is reached or the stepper's
 // Close method is explicitly called.
 func Reader(newr func(r io.Reader) (io.Reader, error)) *StepReader {
-	s := &StepReader{newr: newr}
+	return NewReader(newr)
+}
+
+// NewReader is like Reader, but accepts options that configure the
+// read buffer size, the pending output cap, and the context used by
+// Step and Close.
+func NewReader(newr func(r io.Reader) (io.Reader, error), opts ...Option) *StepReader {
+	s := &StepReader{
+		newr:        newr,
+		ctx:         context.Background(),
+		readBufSize: defaultReadBufferSize,
+		maxPending:  defaultMaxPendingBytes,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
 	s.insig = sync.NewCond(&s.mu)
 	s.outsig = sync.NewCond(&s.mu)
 	s.reading = true
@@ -53,7 +122,24 @@ func Reader(newr func(r io.Reader) (io.Reader, error)) *StepReader {
 //
 // The returned slice is reused by the stepper on the next call,
 // so do not keep any references to its data.
+//
+// Step is equivalent to StepContext with the context set via
+// WithContext, or context.Background() if none was provided.
 func (s *StepReader) Step(data []byte) ([]byte, error) {
+	return s.StepContext(s.ctx, data)
+}
+
+// StepContext is like Step, but aborts and returns ctx.Err() if ctx
+// is done before the output reader produces more data. When that
+// happens, subsequent Steps return ctx.Err() too. The wrapped reader
+// itself is only torn down once its in-flight Read call returns on
+// its own, the same way it would be on reaching EOF: StepContext does
+// not force it to stop. This means a wrapped reader whose Read never
+// returns on its own, such as one blocked on an unrelated resource
+// with no regard for what stepReader feeds it, leaves the read loop
+// goroutine running until the process exits; this is the same
+// trade-off Close already makes without a context.
+func (s *StepReader) StepContext(ctx context.Context, data []byte) ([]byte, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -62,7 +148,7 @@ func (s *StepReader) Step(data []byte) ([]byte, error) {
 		s.insig.Signal()
 	}
 	if s.reading {
-		s.outsig.Wait()
+		s.waitOutput(ctx)
 	}
 
 	s.result, s.output = s.output, s.result
@@ -79,7 +165,18 @@ func (s *StepReader) Step(data []byte) ([]byte, error) {
 //
 // If the Step function is called after the stepper is closed it will
 // return the previous error, or io.EOF if there were no errors.
+//
+// Close is equivalent to CloseContext with the context set via
+// WithContext, or context.Background() if none was provided.
 func (s *StepReader) Close() error {
+	return s.CloseContext(s.ctx)
+}
+
+// CloseContext is like Close, but aborts early and returns ctx.Err()
+// if ctx is done before the output reader finishes draining. As with
+// StepContext, the wrapped reader is only closed once its current
+// Read call returns on its own.
+func (s *StepReader) CloseContext(ctx context.Context) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -89,9 +186,14 @@ func (s *StepReader) Close() error {
 
 	s.input = nil
 	s.insig.Signal()
-	for s.reading {
+	cancel := s.armCancel(ctx)
+	for s.reading && (ctx == nil || ctx.Err() == nil) {
 		s.outsig.Wait()
 	}
+	cancel()
+	if s.reading {
+		return ctx.Err()
+	}
 
 	if s.err == io.EOF {
 		return nil
@@ -99,8 +201,83 @@ func (s *StepReader) Close() error {
 	return s.err
 }
 
+// waitOutput waits for a single signal from the read loop, or for
+// ctx to be done, whichever happens first. The caller must hold s.mu
+// and have already checked that the read loop is still running.
+func (s *StepReader) waitOutput(ctx context.Context) {
+	cancel := s.armCancel(ctx)
+	if ctx == nil || ctx.Err() == nil {
+		s.outsig.Wait()
+	} else {
+		s.cancel(ctx.Err())
+	}
+	cancel()
+}
+
+// armCancel arms a watcher that reacts to ctx being done by recording
+// the error and waking up whoever is waiting on insig or outsig. It
+// does not touch the wrapped reader directly: that reader's Read call
+// may still be running on the read loop goroutine, and closing it
+// concurrently from here would race with that call, which is unsafe
+// for most real decoders (compress/* readers included). Instead, the
+// wrapped reader is closed by readLoop itself, the same way it always
+// is on reaching EOF, once its Read call actually returns. The caller
+// must hold s.mu, and must call the returned func while still holding
+// s.mu once it is done waiting on outsig.
+func (s *StepReader) armCancel(ctx context.Context) func() {
+	if ctx == nil || ctx.Done() == nil {
+		return func() {}
+	}
+	select {
+	case <-ctx.Done():
+		s.cancel(ctx.Err())
+		return func() {}
+	default:
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.cancel(ctx.Err())
+			s.mu.Unlock()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// cancel reacts to ctx being done. It only records the error and wakes
+// up waiters; it leaves closing the wrapped reader to readLoop, which
+// is the only goroutine allowed to call Read or Close on it. The
+// caller must hold s.mu.
+func (s *StepReader) cancel(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+	s.insig.Signal()
+	s.outsig.Broadcast()
+}
+
+// closeWrapped closes the wrapped reader if it implements io.Closer,
+// at most once. The caller must not hold s.mu.
+func (s *StepReader) closeWrapped(r io.Reader) error {
+	s.mu.Lock()
+	if s.wrappedDone {
+		s.mu.Unlock()
+		return nil
+	}
+	s.wrappedDone = true
+	s.mu.Unlock()
+
+	if c, ok := r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
 func (s *StepReader) readLoop() {
-	data := make([]byte, 8192)
+	data := make([]byte, s.readBufSize)
 
 	r, err := s.newr(&stepReader{s})
 	if err != nil {
@@ -111,11 +288,15 @@ func (s *StepReader) readLoop() {
 		s.mu.Unlock()
 		return
 	}
+
+	s.mu.Lock()
+	s.wrapped = r
+	s.mu.Unlock()
+
 	for {
 		n, err := r.Read(data)
 		s.mu.Lock()
-		// This limit should probably be configurable.
-		if n+len(s.output) > 1024*1024 {
+		if !s.unboundedPending && n+len(s.output) > s.maxPending {
 			n = 0
 			err = fmt.Errorf("excessive data on single step")
 		}
@@ -124,11 +305,11 @@ func (s *StepReader) readLoop() {
 			if s.err == nil {
 				s.err = err
 			}
-			if c, ok := r.(io.Closer); ok {
-				err := c.Close()
-				if err != nil && s.err == nil {
-					s.err = err
-				}
+			s.mu.Unlock()
+			closeErr := s.closeWrapped(r)
+			s.mu.Lock()
+			if closeErr != nil && s.err == nil {
+				s.err = closeErr
 			}
 
 			s.reading = false
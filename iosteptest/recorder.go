@@ -0,0 +1,77 @@
+// Package iosteptest provides helpers for writing tests against an
+// iostep.StepReader without hand-rolling accumulate-and-compare
+// loops across Step calls.
+package iosteptest
+
+import (
+	"fmt"
+	"regexp"
+
+	"gopkg.in/niemeyer/iostep.v0"
+)
+
+// A Recorder wraps a *iostep.StepReader, buffering all the output it
+// has ever produced across Step calls, and offers gbytes-style
+// matchers against that accumulated buffer.
+type Recorder struct {
+	s   *iostep.StepReader
+	buf []byte
+	at  int
+}
+
+// NewRecorder returns a Recorder that drives s and records its
+// output.
+func NewRecorder(s *iostep.StepReader) *Recorder {
+	return &Recorder{s: s}
+}
+
+// Step feeds data through the wrapped StepReader and appends whatever
+// it produces to the recorded buffer.
+func (r *Recorder) Step(data []byte) error {
+	out, err := r.s.Step(data)
+	r.buf = append(r.buf, out...)
+	return err
+}
+
+// Say reports whether pattern matches the recorded buffer at or
+// after the cursor left behind by the last successful Say. On a
+// match, the cursor advances past it, so a later Say call only sees
+// what comes after; on failure, the cursor is left untouched so a
+// retry (e.g. from Eventually) can match against the same data plus
+// whatever Step appends next.
+//
+// Say panics if pattern fails to compile as a regexp, just like
+// gbytes' Say does.
+func (r *Recorder) Say(pattern string) bool {
+	loc := regexp.MustCompile(pattern).FindIndex(r.buf[r.at:])
+	if loc == nil {
+		return false
+	}
+	r.at += loc[1]
+	return true
+}
+
+// Eventually calls feed(i) for i in [0, steps) and feeds the result
+// into Step, checking Say(pattern) after each one, until it matches
+// or steps calls have been made. It returns an error if the pattern
+// never matches, or if a Step call fails along the way.
+func (r *Recorder) Eventually(pattern string, steps int, feed func(i int) []byte) error {
+	for i := 0; i < steps; i++ {
+		if r.Say(pattern) {
+			return nil
+		}
+		if err := r.Step(feed(i)); err != nil {
+			return err
+		}
+	}
+	if r.Say(pattern) {
+		return nil
+	}
+	return fmt.Errorf("iosteptest: pattern %q did not match after %d steps", pattern, steps)
+}
+
+// Remaining returns the recorded output that hasn't been consumed by
+// a successful Say yet.
+func (r *Recorder) Remaining() []byte {
+	return r.buf[r.at:]
+}
@@ -0,0 +1,35 @@
+package iosteptest_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+
+	"gopkg.in/niemeyer/iostep.v0"
+	"gopkg.in/niemeyer/iostep.v0/iosteptest"
+)
+
+func ExampleRecorder() {
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write([]byte("Hello world!\n"))
+	w.Close()
+	data := compressed.Bytes()
+
+	s := iostep.Reader(func(r io.Reader) (io.Reader, error) {
+		return zlib.NewReader(r)
+	})
+	r := iosteptest.NewRecorder(s)
+
+	i := 0
+	err := r.Eventually(`wor..!`, len(data), func(int) []byte {
+		b := data[i : i+1]
+		i++
+		return b
+	})
+	fmt.Printf("matched: %v, remaining: %q\n", err == nil, r.Remaining())
+
+	// Output:
+	// matched: true, remaining: "\n"
+}
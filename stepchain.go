@@ -0,0 +1,114 @@
+package iostep
+
+import "io"
+
+// Chain composes several StepReaders into a single stepper: each
+// Step call pushes data through steppers[0], feeds whatever it
+// produced into steppers[1], and so on, returning the output of the
+// last stage. This lets non-trivial decoder stacks, such as
+// base64-decode -> zlib-inflate -> tar-parse, be built out of
+// existing StepReaders without hand-wiring a goroutine and a pipe per
+// stage.
+//
+// Close propagates through the chain in order: each stage is told to
+// close only after the previous stage's trailing output has been fed
+// to it, so that checksums and other end-of-stream data a stage only
+// emits once it knows no more input is coming get a chance to flow
+// downstream too.
+func Chain(steppers ...*StepReader) *StepReader {
+	return Reader(func(r io.Reader) (io.Reader, error) {
+		return &chainReader{r: r, steppers: steppers}, nil
+	})
+}
+
+// ChainReader is like Chain, but builds each stage from the given
+// factories, the same way Reader does for a single stage.
+func ChainReader(factories ...func(r io.Reader) (io.Reader, error)) *StepReader {
+	steppers := make([]*StepReader, len(factories))
+	for i, newr := range factories {
+		steppers[i] = Reader(newr)
+	}
+	return Chain(steppers...)
+}
+
+// A chainReader is the io.Reader backing a chained StepReader: its
+// Read method is driven by the outer StepReader's read loop, and
+// drives every stage's Step method in turn.
+type chainReader struct {
+	r        io.Reader
+	steppers []*StepReader
+
+	pending []byte
+	err     error
+}
+
+func (c *chainReader) Read(data []byte) (int, error) {
+	for len(c.pending) == 0 && c.err == nil {
+		buf := make([]byte, len(data))
+		n, rerr := c.r.Read(buf)
+		buf = buf[:n]
+
+		var stepErr error
+		for _, s := range c.steppers {
+			out, err := s.Step(buf)
+			buf = append([]byte(nil), out...)
+			if err != nil {
+				stepErr = err
+				break
+			}
+		}
+		c.pending = buf
+
+		switch {
+		case stepErr != nil:
+			c.err = stepErr
+		case rerr != nil:
+			drained, closeErr := c.closeSteppers()
+			c.pending = append(c.pending, drained...)
+			if closeErr != nil {
+				c.err = closeErr
+			} else {
+				c.err = rerr
+			}
+		}
+	}
+	if len(c.pending) > 0 {
+		n := copy(data, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	return 0, c.err
+}
+
+// closeSteppers tells every stage, in order, that no more input of
+// its own is coming, threading each stage's trailing output into the
+// next one before closing it in turn.
+func (c *chainReader) closeSteppers() ([]byte, error) {
+	var buf []byte
+	for _, s := range c.steppers {
+		if len(buf) > 0 {
+			out, err := s.Step(buf)
+			buf = append([]byte(nil), out...)
+			if err != nil && err != io.EOF {
+				return buf, err
+			}
+		}
+		if err := s.Close(); err != nil {
+			return buf, err
+		}
+		out, err := s.Step(nil)
+		buf = append(buf, out...)
+		if err != nil && err != io.EOF {
+			return buf, err
+		}
+	}
+	return buf, nil
+}
+
+// Close closes every stage in order, draining and discarding the
+// trailing output each one produces as it does, consistent with
+// StepReader.Close not returning data of its own.
+func (c *chainReader) Close() error {
+	_, err := c.closeSteppers()
+	return err
+}
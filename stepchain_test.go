@@ -0,0 +1,49 @@
+package iostep_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"gopkg.in/niemeyer/iostep.v0"
+)
+
+func ExampleChain() {
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write([]byte("Hello chained world!\n"))
+	w.Close()
+	encoded := base64.StdEncoding.EncodeToString(compressed.Bytes())
+
+	s := iostep.ChainReader(
+		func(r io.Reader) (io.Reader, error) {
+			return base64.NewDecoder(base64.StdEncoding, r), nil
+		},
+		func(r io.Reader) (io.Reader, error) {
+			return zlib.NewReader(r)
+		},
+	)
+
+	var got []byte
+	for i := 0; i < len(encoded); i += 8 {
+		j := i + 8
+		if j > len(encoded) {
+			j = len(encoded)
+		}
+		out, err := s.Step([]byte(encoded[i:j]))
+		got = append(got, out...)
+		if err != nil {
+			fmt.Printf("unexpected error: %v\n", err)
+			return
+		}
+	}
+	out, err := s.Step(nil)
+	got = append(got, out...)
+
+	fmt.Printf("%q, %v\n", got, err)
+
+	// Output:
+	// "Hello chained world!\n", <nil>
+}
@@ -0,0 +1,125 @@
+package iostep
+
+import (
+	"io"
+	"sync"
+)
+
+// A Frame is a single chunk of data tagged with the logical stream
+// it belongs to, as produced by the splitter function passed to
+// Demux.
+type Frame struct {
+	StreamID uint64
+	Data     []byte
+}
+
+// A StepDemux fans a single physical input apart into several
+// logical streams, each decoded by its own StepReader, turning
+// iostep into a building block for blocking parsers layered over a
+// multiplexed transport.
+type StepDemux struct {
+	mu sync.Mutex
+
+	split  func(chunk []byte) []Frame
+	newSub func(streamID uint64, r io.Reader) (io.Reader, error)
+
+	// subs holds one StepReader per stream that hasn't reached EOF
+	// (or failed) yet. Entries are removed as soon as a stream is
+	// done, so this stays bounded by the number of streams active at
+	// once rather than the number ever seen.
+	subs map[uint64]*StepReader
+
+	// done remembers every stream id that has already finished, so
+	// that stray frames for it are silently dropped instead of
+	// starting a new substream. Unlike subs, this is never pruned: it
+	// gains one entry for every stream that finishes, so it grows with
+	// the number of distinct stream ids seen over the life of the
+	// StepDemux, and a stream id reused after its stream finished never
+	// starts a new substream.
+	done map[uint64]bool
+}
+
+// Demux returns a new StepDemux. The split function breaks each
+// chunk passed to Step into the frames it contains. The newSub
+// function is called the first time a frame for a given stream id is
+// seen, and plays the same role as the function passed to Reader,
+// but once per logical stream.
+func Demux(split func(chunk []byte) []Frame, newSub func(streamID uint64, r io.Reader) (io.Reader, error)) *StepDemux {
+	return &StepDemux{
+		split:  split,
+		newSub: newSub,
+		subs:   make(map[uint64]*StepReader),
+		done:   make(map[uint64]bool),
+	}
+}
+
+// Step splits data into frames and routes each one to its logical
+// stream's StepReader, accumulating whatever each substream produced
+// during this call. It returns the accumulated output keyed by
+// stream id, and the set of streams whose substream reached EOF (or
+// failed) as a result of this step.
+//
+// Frames for a stream that has already reached EOF are silently
+// dropped.
+func (d *StepDemux) Step(data []byte) (output map[uint64][]byte, eof map[uint64]bool) {
+	output = make(map[uint64][]byte)
+	eof = make(map[uint64]bool)
+
+	for _, frame := range d.split(data) {
+		out, err := d.stepFrame(frame)
+		if len(out) > 0 {
+			output[frame.StreamID] = append(output[frame.StreamID], out...)
+		}
+		if err != nil {
+			eof[frame.StreamID] = true
+		}
+	}
+	return output, eof
+}
+
+func (d *StepDemux) stepFrame(frame Frame) ([]byte, error) {
+	d.mu.Lock()
+	if d.done[frame.StreamID] {
+		d.mu.Unlock()
+		return nil, nil
+	}
+	sub, ok := d.subs[frame.StreamID]
+	if !ok {
+		streamID := frame.StreamID
+		sub = Reader(func(r io.Reader) (io.Reader, error) {
+			return d.newSub(streamID, r)
+		})
+		d.subs[frame.StreamID] = sub
+	}
+	d.mu.Unlock()
+
+	out, err := sub.Step(frame.Data)
+	if err != nil {
+		d.mu.Lock()
+		d.done[frame.StreamID] = true
+		delete(d.subs, frame.StreamID)
+		d.mu.Unlock()
+	}
+	return out, err
+}
+
+// Close closes every substream that has not yet reached EOF, and
+// returns the first error encountered, if any.
+func (d *StepDemux) Close() error {
+	d.mu.Lock()
+	var subs []*StepReader
+	for id, sub := range d.subs {
+		subs = append(subs, sub)
+		d.done[id] = true
+		delete(d.subs, id)
+	}
+	d.mu.Unlock()
+
+	var firstErr error
+	for _, sub := range subs {
+		if err := sub.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
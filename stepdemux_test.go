@@ -0,0 +1,94 @@
+package iostep_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"gopkg.in/niemeyer/iostep.v0"
+)
+
+func printStep(output map[uint64][]byte, eof map[uint64]bool) {
+	var ids []uint64
+	for id := range output {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		fmt.Printf("stream %d: %q\n", id, output[id])
+	}
+
+	ids = ids[:0]
+	for id := range eof {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		fmt.Printf("stream %d: eof\n", id)
+	}
+}
+
+// encodeFrames packs frames using a trivial [streamID uint64][length
+// uint32][payload] framing, good enough to drive ExampleStepDemux.
+func encodeFrames(frames []iostep.Frame) []byte {
+	var buf bytes.Buffer
+	for _, f := range frames {
+		binary.Write(&buf, binary.BigEndian, f.StreamID)
+		binary.Write(&buf, binary.BigEndian, uint32(len(f.Data)))
+		buf.Write(f.Data)
+	}
+	return buf.Bytes()
+}
+
+func splitFrames(chunk []byte) []iostep.Frame {
+	var frames []iostep.Frame
+	for len(chunk) > 0 {
+		streamID := binary.BigEndian.Uint64(chunk[:8])
+		length := binary.BigEndian.Uint32(chunk[8:12])
+		chunk = chunk[12:]
+		frames = append(frames, iostep.Frame{StreamID: streamID, Data: chunk[:length]})
+		chunk = chunk[length:]
+	}
+	return frames
+}
+
+func ExampleStepDemux() {
+	var compressed [2]bytes.Buffer
+	for i, text := range [2]string{"Hello A\n", "Hello B\n"} {
+		w := zlib.NewWriter(&compressed[i])
+		w.Write([]byte(text))
+		w.Close()
+	}
+
+	d := iostep.Demux(splitFrames, func(streamID uint64, r io.Reader) (io.Reader, error) {
+		return zlib.NewReader(r)
+	})
+
+	input := encodeFrames([]iostep.Frame{
+		{StreamID: 1, Data: compressed[0].Bytes()[:10]},
+		{StreamID: 2, Data: compressed[1].Bytes()[:10]},
+		{StreamID: 1, Data: compressed[0].Bytes()[10:]},
+		{StreamID: 2, Data: compressed[1].Bytes()[10:]},
+	})
+
+	output, eof := d.Step(input)
+	printStep(output, eof)
+
+	// Nudge each substream so it notices it has reached the end of
+	// its compressed stream, just like a plain StepReader does.
+	nudge := encodeFrames([]iostep.Frame{
+		{StreamID: 1},
+		{StreamID: 2},
+	})
+	output, eof = d.Step(nudge)
+	printStep(output, eof)
+
+	// Output:
+	// stream 1: "Hello A\n"
+	// stream 2: "Hello B\n"
+	// stream 1: eof
+	// stream 2: eof
+}
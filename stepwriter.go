@@ -0,0 +1,255 @@
+package iostep
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+const defaultWriterMaxPendingBytes = 1024 * 1024
+
+// A StepWriter transforms a writer type that processes data in a
+// blocking way into a simpler non-blocking interface that processes
+// data with a single Step function.
+//
+// It is the symmetric counterpart of StepReader: while StepReader
+// wraps a blocking reader to decode data as it is fed in, StepWriter
+// wraps a blocking writer to encode data as it is fed in.
+type StepWriter struct {
+	mu  sync.Mutex
+	err error
+
+	neww func(w io.Writer) (io.WriteCloser, error)
+
+	maxPending       int
+	unboundedPending bool
+
+	input   []byte
+	flush   bool
+	closing bool
+	pending bool
+	insig   *sync.Cond
+
+	output []byte
+	outsig *sync.Cond
+
+	result []byte
+
+	writing bool
+	closed  bool
+}
+
+// A WriterOption configures a StepWriter created by NewWriter.
+type WriterOption func(*StepWriter)
+
+// WithWriterMaxPendingBytes sets how many bytes of output the wrapped
+// writer may produce ahead of a single Step call before the stepper
+// gives up with an error. It defaults to 1 MiB.
+func WithWriterMaxPendingBytes(n int) WriterOption {
+	return func(s *StepWriter) {
+		s.maxPending = n
+		s.unboundedPending = false
+	}
+}
+
+// WithWriterUnboundedPending disables the pending output cap
+// entirely, for wrapped writers that are known to produce far more
+// output than their input in a single call, such as streaming
+// encoders flushing a large buffered block.
+func WithWriterUnboundedPending() WriterOption {
+	return func(s *StepWriter) {
+		s.unboundedPending = true
+	}
+}
+
+// Writer returns a new stepper that uses the writer returned by the
+// provided function to process data. The function will receive as a
+// parameter a writer that will collect the data produced by the
+// returned writer as the Step, Flush and Close functions are called.
+func Writer(neww func(w io.Writer) (io.WriteCloser, error)) *StepWriter {
+	return NewWriter(neww)
+}
+
+// NewWriter is like Writer, but accepts options that configure the
+// pending output cap.
+func NewWriter(neww func(w io.Writer) (io.WriteCloser, error), opts ...WriterOption) *StepWriter {
+	s := &StepWriter{
+		neww:       neww,
+		maxPending: defaultWriterMaxPendingBytes,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.insig = sync.NewCond(&s.mu)
+	s.outsig = sync.NewCond(&s.mu)
+	s.writing = true
+	go s.writeLoop()
+	return s
+}
+
+// Step feeds data through the input writer, and returns all the data
+// that was made available by the output writer after that.
+//
+// The returned slice is reused by the stepper on the next call, so do
+// not keep any references to its data.
+func (s *StepWriter) Step(data []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err == nil {
+		s.input = data
+		s.pending = true
+		s.insig.Signal()
+		for s.pending {
+			s.outsig.Wait()
+		}
+	}
+
+	s.result, s.output = s.output, s.result
+	s.output = s.output[:0]
+
+	if len(s.result) > 0 {
+		return s.result, nil
+	}
+	return nil, s.err
+}
+
+// Flush asks the underlying writer to push out any data it is
+// currently holding on to, and returns whatever data that produced.
+//
+// If the underlying writer does not implement an equivalent Flush
+// method, this is a no-op.
+func (s *StepWriter) Flush() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err == nil {
+		s.flush = true
+		s.pending = true
+		s.insig.Signal()
+		for s.pending {
+			s.outsig.Wait()
+		}
+	}
+
+	s.result, s.output = s.output, s.result
+	s.output = s.output[:0]
+
+	if len(s.result) > 0 {
+		return s.result, nil
+	}
+	return nil, s.err
+}
+
+// Close finalizes the underlying writer, which gives it the chance to
+// write any trailing data such as checksums or terminators, and
+// returns whatever data that produced.
+//
+// If the Step or Flush functions are called after the stepper is
+// closed they will return the previous error, or io.EOF if there
+// were no errors.
+func (s *StepWriter) Close() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		if s.writing {
+			s.closing = true
+			s.pending = true
+			s.insig.Signal()
+			for s.pending {
+				s.outsig.Wait()
+			}
+		}
+		if s.err == nil {
+			s.err = io.EOF
+		}
+	}
+
+	s.result, s.output = s.output, s.result
+	s.output = s.output[:0]
+
+	err := s.err
+	if err == io.EOF {
+		err = nil
+	}
+	if len(s.result) > 0 {
+		return s.result, err
+	}
+	return nil, err
+}
+
+func (s *StepWriter) writeLoop() {
+	w, err := s.neww(&stepWriter{s})
+	if err != nil {
+		s.mu.Lock()
+		s.err = err
+		s.writing = false
+		s.pending = false
+		s.outsig.Signal()
+		s.mu.Unlock()
+		return
+	}
+	for {
+		s.mu.Lock()
+		for !s.pending {
+			s.insig.Wait()
+		}
+		data := s.input
+		flush := s.flush
+		closing := s.closing
+		s.input = nil
+		s.flush = false
+		s.closing = false
+		s.mu.Unlock()
+
+		var werr error
+		if len(data) > 0 {
+			_, werr = w.Write(data)
+		}
+		if werr == nil && flush {
+			if f, ok := w.(flusher); ok {
+				werr = f.Flush()
+			}
+		}
+		if werr == nil && closing {
+			werr = w.Close()
+		}
+
+		s.mu.Lock()
+		if werr != nil && s.err == nil {
+			s.err = werr
+		}
+		s.pending = false
+		if closing || s.err != nil {
+			s.writing = false
+			s.outsig.Signal()
+			s.mu.Unlock()
+			return
+		}
+		s.outsig.Signal()
+		s.mu.Unlock()
+	}
+}
+
+// flusher is implemented by the writers in the compress/* packages,
+// such as *zlib.Writer, *gzip.Writer and *flate.Writer.
+type flusher interface {
+	Flush() error
+}
+
+type stepWriter struct {
+	s *StepWriter
+}
+
+func (w *stepWriter) Write(data []byte) (int, error) {
+	w.s.mu.Lock()
+	defer w.s.mu.Unlock()
+
+	if !w.s.unboundedPending && len(data)+len(w.s.output) > w.s.maxPending {
+		return 0, fmt.Errorf("excessive data on single step")
+	}
+	w.s.output = append(w.s.output, data...)
+	return len(data), nil
+}
@@ -0,0 +1,109 @@
+package iostep_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"gopkg.in/niemeyer/iostep.v0"
+)
+
+// nopWriteCloser adapts an io.Writer into an io.WriteCloser with a
+// no-op Close, for tests that only care about the output cap and
+// don't need a real encoder.
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// errWriter always fails, to exercise what happens to a StepWriter
+// once its write loop has already given up.
+type errWriter struct{}
+
+func (errWriter) Write(data []byte) (int, error) { return 0, fmt.Errorf("write failed") }
+func (errWriter) Close() error                   { return nil }
+
+func TestWriterCloseAfterError(t *testing.T) {
+	s := iostep.Writer(func(w io.Writer) (io.WriteCloser, error) {
+		return errWriter{}, nil
+	})
+
+	if _, err := s.Step([]byte("x")); err == nil {
+		t.Fatalf("want an error from Step, got nil")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Close hung after the write loop had already stopped")
+	}
+}
+
+func TestWriterWithMaxPendingBytes(t *testing.T) {
+	s := iostep.NewWriter(func(w io.Writer) (io.WriteCloser, error) {
+		return nopWriteCloser{w}, nil
+	}, iostep.WithWriterMaxPendingBytes(4))
+
+	_, err := s.Step([]byte("too much data"))
+	if err == nil {
+		t.Fatalf("want an error, got nil")
+	}
+}
+
+func TestWriterWithUnboundedPending(t *testing.T) {
+	s := iostep.NewWriter(func(w io.Writer) (io.WriteCloser, error) {
+		return nopWriteCloser{w}, nil
+	}, iostep.WithWriterMaxPendingBytes(4), iostep.WithWriterUnboundedPending())
+
+	got, err := s.Step([]byte("more than four bytes"))
+	if err != nil || string(got) != "more than four bytes" {
+		t.Fatalf("want %q, got %q with err %v", "more than four bytes", got, err)
+	}
+}
+
+func ExampleStepWriter() {
+	s := iostep.Writer(func(w io.Writer) (io.WriteCloser, error) {
+		return zlib.NewWriter(w), nil
+	})
+
+	var compressed []byte
+
+	out, err := s.Step([]byte("Hello world!\n"))
+	compressed = append(compressed, out...)
+	fmt.Printf("step: %q, %v\n", out, err)
+
+	out, err = s.Flush()
+	compressed = append(compressed, out...)
+	fmt.Printf("flush: %v, %v\n", len(out) > 0, err)
+
+	out, err = s.Step([]byte("Hello once more!\n"))
+	compressed = append(compressed, out...)
+	fmt.Printf("step: %q, %v\n", out, err)
+
+	out, err = s.Close()
+	compressed = append(compressed, out...)
+	fmt.Printf("close: %v, %v\n", len(out) > 0, err)
+
+	r, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		fmt.Printf("bad output: %v", err)
+		return
+	}
+	plain, err := ioutil.ReadAll(r)
+	fmt.Printf("plain: %q, %v\n", plain, err)
+
+	// Output:
+	// step: "x\x9c", <nil>
+	// flush: true, <nil>
+	// step: "", <nil>
+	// close: true, <nil>
+	// plain: "Hello world!\nHello once more!\n", <nil>
+}